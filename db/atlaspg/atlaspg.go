@@ -0,0 +1,196 @@
+// Package atlaspg implements api0.AccountStorage on PostgreSQL.
+//
+// It is schema-compatible with db/atlasdb (the sqlite3 implementation): an
+// operator can dump the sqlite3 database and load it into postgres without
+// a conversion step, which makes it possible to migrate a single-instance
+// deployment into a clustered one. Unlike atlasdb, a *Store here may be
+// shared by multiple Atlas processes at once, so writes that need to
+// observe-then-update (such as persona name changes) take a row lock with
+// SELECT ... FOR UPDATE rather than relying on single-writer semantics.
+package atlaspg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/r2northstar/atlas/pkg/api/api0"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// Store is a PostgreSQL-backed api0.AccountStorage.
+type Store struct {
+	db *sql.DB
+}
+
+var _ api0.AccountStorage = (*Store)(nil)
+
+// Open opens (and pings) the postgres database at dsn. The returned Store
+// pools connections internally; callers should not open more than one Store
+// per dsn.
+func Open(dsn string) (*Store, error) {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open: %w", err)
+	}
+	db.SetMaxOpenConns(16)
+	db.SetMaxIdleConns(4)
+	if err := db.PingContext(context.Background()); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("ping: %w", err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Close closes the underlying connection pool.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Version returns the current schema version of the database and the target
+// version known to this version of atlaspg, analogous to atlasdb.Version.
+func (s *Store) Version() (cur, to int, err error) {
+	to = len(migrations)
+	err = s.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM atlas_schema_migrations`).Scan(&cur)
+	if err != nil {
+		if isUndefinedTable(err) {
+			return 0, to, nil
+		}
+		return 0, to, fmt.Errorf("query schema version: %w", err)
+	}
+	return cur, to, nil
+}
+
+// migrationLockKey is the pg_advisory_lock key MigrateUp holds for the
+// duration of its check-then-migrate sequence, so two Atlas instances
+// starting at once against a fresh database don't both try to create
+// atlas_schema_migrations/accounts. It's an arbitrary constant that just
+// needs to not collide with other advisory lock users on the same database.
+const migrationLockKey = 0x41746c61734163 // "AtlasAc"
+
+// MigrateUp migrates the database up to (and including) version to, which
+// must be <= len(migrations).
+func (s *Store) MigrateUp(ctx context.Context, to int) error {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("migrate: acquire connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockKey); err != nil {
+		return fmt.Errorf("migrate: acquire lock: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockKey)
+
+	cur, max, err := s.Version()
+	if err != nil {
+		return err
+	}
+	if to > max {
+		return fmt.Errorf("migrate: version %d is newer than the latest known version %d", to, max)
+	}
+	for v := cur; v < to; v++ {
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("migrate to %d: begin tx: %w", v+1, err)
+		}
+		if _, err := tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS atlas_schema_migrations (version integer NOT NULL)`); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migrate to %d: create migrations table: %w", v+1, err)
+		}
+		if _, err := tx.ExecContext(ctx, migrations[v]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migrate to %d: %w", v+1, err)
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM atlas_schema_migrations`); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migrate to %d: update version: %w", v+1, err)
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO atlas_schema_migrations (version) VALUES ($1)`, v+1); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migrate to %d: update version: %w", v+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("migrate to %d: commit: %w", v+1, err)
+		}
+	}
+	return nil
+}
+
+// migrations contains the schema for each version, in the same order and
+// with the same semantics as the tables created by db/atlasdb, so a
+// sqlite3 dump can be loaded verbatim.
+var migrations = []string{
+	// v1: initial schema.
+	`CREATE TABLE IF NOT EXISTS accounts (
+		id               bigint PRIMARY KEY,
+		auth_ip          text NOT NULL DEFAULT '',
+		last_auth_ip     text NOT NULL DEFAULT '',
+		auth_token       text NOT NULL DEFAULT '',
+		auth_token_expiry timestamptz,
+		persona_name     text NOT NULL DEFAULT '',
+		hardware_id      text NOT NULL DEFAULT '',
+		created_at       timestamptz NOT NULL DEFAULT now()
+	)`,
+}
+
+func isUndefinedTable(err error) bool {
+	var pgErr interface{ SQLState() string }
+	if errors.As(err, &pgErr) {
+		return pgErr.SQLState() == "42P01"
+	}
+	return false
+}
+
+// GetAccount returns the account with the provided id, or nil if it does not exist.
+func (s *Store) GetAccount(ctx context.Context, id uint64) (*api0.Account, error) {
+	var a api0.Account
+	var expiry sql.NullTime
+	err := s.db.QueryRowContext(ctx, `SELECT id, auth_ip, last_auth_ip, auth_token, auth_token_expiry, persona_name, hardware_id FROM accounts WHERE id = $1`, id).
+		Scan(&a.ID, &a.AuthIP, &a.LastAuthIP, &a.AuthToken, &expiry, &a.PersonaName, &a.HardwareID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get account %d: %w", id, err)
+	}
+	a.AuthTokenExpiry = expiry.Time
+	return &a, nil
+}
+
+// SaveAccount creates or updates an account, taking a row lock first so
+// concurrent updates from other Atlas instances cannot race.
+func (s *Store) SaveAccount(ctx context.Context, a *api0.Account) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("save account %d: begin tx: %w", a.ID, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT id FROM accounts WHERE id = $1 FOR UPDATE`, a.ID); err != nil {
+		return fmt.Errorf("save account %d: lock: %w", a.ID, err)
+	}
+	var expiry sql.NullTime
+	if !a.AuthTokenExpiry.IsZero() {
+		expiry = sql.NullTime{Time: a.AuthTokenExpiry, Valid: true}
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO accounts (id, auth_ip, last_auth_ip, auth_token, auth_token_expiry, persona_name, hardware_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (id) DO UPDATE SET
+			auth_ip = EXCLUDED.auth_ip,
+			last_auth_ip = EXCLUDED.last_auth_ip,
+			auth_token = EXCLUDED.auth_token,
+			auth_token_expiry = EXCLUDED.auth_token_expiry,
+			persona_name = EXCLUDED.persona_name,
+			hardware_id = EXCLUDED.hardware_id
+	`, a.ID, a.AuthIP, a.LastAuthIP, a.AuthToken, expiry, a.PersonaName, a.HardwareID); err != nil {
+		return fmt.Errorf("save account %d: %w", a.ID, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("save account %d: commit: %w", a.ID, err)
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+// Package pdatapg implements api0.PdataStorage on PostgreSQL.
+//
+// It mirrors db/pdatadb's schema and versioned migration scheme so a
+// sqlite3 pdata database can be dumped and loaded into postgres as-is.
+// Since multiple Atlas instances may share one Store, Set takes the row
+// lock with SELECT ... FOR UPDATE before writing so a read-modify-write
+// from one instance can't be torn by a concurrent write from another.
+package pdatapg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/r2northstar/atlas/pkg/api/api0"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// Store is a PostgreSQL-backed api0.PdataStorage.
+type Store struct {
+	db *sql.DB
+}
+
+var _ api0.PdataStorage = (*Store)(nil)
+
+// Open opens (and pings) the postgres database at dsn.
+func Open(dsn string) (*Store, error) {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open: %w", err)
+	}
+	db.SetMaxOpenConns(16)
+	db.SetMaxIdleConns(4)
+	if err := db.PingContext(context.Background()); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("ping: %w", err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Close closes the underlying connection pool.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Version returns the current and target schema versions, like atlasdb.Version.
+func (s *Store) Version() (cur, to int, err error) {
+	to = len(migrations)
+	err = s.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM pdata_schema_migrations`).Scan(&cur)
+	if err != nil {
+		if isUndefinedTable(err) {
+			return 0, to, nil
+		}
+		return 0, to, fmt.Errorf("query schema version: %w", err)
+	}
+	return cur, to, nil
+}
+
+// migrationLockKey is the pg_advisory_lock key MigrateUp holds for the
+// duration of its check-then-migrate sequence, so two Atlas instances
+// starting at once against a fresh database don't both try to create
+// pdata_schema_migrations/pdata. It's an arbitrary constant that just needs
+// to not collide with other advisory lock users on the same database.
+const migrationLockKey = 0x41746c617350 // "AtlasP"
+
+// MigrateUp migrates the database up to (and including) version to.
+func (s *Store) MigrateUp(ctx context.Context, to int) error {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("migrate: acquire connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockKey); err != nil {
+		return fmt.Errorf("migrate: acquire lock: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockKey)
+
+	cur, max, err := s.Version()
+	if err != nil {
+		return err
+	}
+	if to > max {
+		return fmt.Errorf("migrate: version %d is newer than the latest known version %d", to, max)
+	}
+	for v := cur; v < to; v++ {
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("migrate to %d: begin tx: %w", v+1, err)
+		}
+		if _, err := tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS pdata_schema_migrations (version integer NOT NULL)`); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migrate to %d: create migrations table: %w", v+1, err)
+		}
+		if _, err := tx.ExecContext(ctx, migrations[v]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migrate to %d: %w", v+1, err)
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM pdata_schema_migrations`); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migrate to %d: update version: %w", v+1, err)
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO pdata_schema_migrations (version) VALUES ($1)`, v+1); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migrate to %d: update version: %w", v+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("migrate to %d: commit: %w", v+1, err)
+		}
+	}
+	return nil
+}
+
+var migrations = []string{
+	// v1: initial schema.
+	`CREATE TABLE IF NOT EXISTS pdata (
+		id   bigint PRIMARY KEY,
+		data bytea NOT NULL
+	)`,
+}
+
+func isUndefinedTable(err error) bool {
+	var pgErr interface{ SQLState() string }
+	if errors.As(err, &pgErr) {
+		return pgErr.SQLState() == "42P01"
+	}
+	return false
+}
+
+// Get returns the pdata for id, or nil if none is stored.
+func (s *Store) Get(ctx context.Context, id uint64) ([]byte, error) {
+	var buf []byte
+	err := s.db.QueryRowContext(ctx, `SELECT data FROM pdata WHERE id = $1`, id).Scan(&buf)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get pdata %d: %w", id, err)
+	}
+	return buf, nil
+}
+
+// Set stores the pdata for id, locking the row first (creating it if
+// necessary) so concurrent writers across Atlas instances don't tear each
+// other's updates.
+func (s *Store) Set(ctx context.Context, id uint64, buf []byte) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("set pdata %d: begin tx: %w", id, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO pdata (id, data) VALUES ($1, ''::bytea)
+		ON CONFLICT (id) DO NOTHING
+	`, id); err != nil {
+		return fmt.Errorf("set pdata %d: ensure row: %w", id, err)
+	}
+	if _, err := tx.ExecContext(ctx, `SELECT id FROM pdata WHERE id = $1 FOR UPDATE`, id); err != nil {
+		return fmt.Errorf("set pdata %d: lock: %w", id, err)
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE pdata SET data = $2 WHERE id = $1`, id, buf); err != nil {
+		return fmt.Errorf("set pdata %d: %w", id, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("set pdata %d: commit: %w", id, err)
+	}
+	return nil
+}
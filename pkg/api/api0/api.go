@@ -10,8 +10,6 @@
 package api0
 
 import (
-	"bytes"
-	"compress/gzip"
 	"encoding/json"
 	"net/http"
 	"strconv"
@@ -20,14 +18,18 @@ import (
 
 type Handler struct {
 	PdataStorage PdataStorage
+	RateLimits   *RateLimits
 }
 
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Server", "Atlas")
 
+	if !h.checkRateLimit(w, r) {
+		return
+	}
+
 	switch {
 	case strings.HasPrefix(r.URL.Path, "/player/"):
-		// TODO: rate limit
 		h.handlePlayer(w, r)
 		return
 	default:
@@ -47,22 +49,17 @@ func respJSON(w http.ResponseWriter, status int, obj any) {
 	w.Write(buf)
 }
 
+// respMaybeCompress writes buf as the response body, compressing it with
+// the client's most preferred mutually-supported encoding (zstd, then br,
+// then gzip) if doing so saves enough to be worth it.
 func respMaybeCompress(w http.ResponseWriter, r *http.Request, status int, buf []byte) {
-	for _, e := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
-		if t, _, _ := strings.Cut(e, ";"); strings.TrimSpace(t) == "gzip" {
-			var cbuf bytes.Buffer
-			gw := gzip.NewWriter(&cbuf)
-			if _, err := gw.Write(buf); err != nil {
-				break
-			}
-			if err := gw.Close(); err != nil {
-				break
-			}
-			if cbuf.Len() < int(float64(len(buf))*0.8) {
-				buf = cbuf.Bytes()
-				w.Header().Set("Content-Encoding", "gzip")
+	if len(buf) >= compressMinSize {
+		w.Header().Set("Vary", "Accept-Encoding")
+		if enc := negotiateEncoding(r.Header.Get("Accept-Encoding")); enc != "" {
+			if cbuf := encodingCompressor(enc)(buf); cbuf != nil && len(cbuf) < int(float64(len(buf))*compressMinRatio) {
+				buf = cbuf
+				w.Header().Set("Content-Encoding", enc)
 			}
-			break
 		}
 	}
 	w.Header().Set("Content-Length", strconv.Itoa(len(buf)))
@@ -0,0 +1,157 @@
+package api0
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressMinSize is the smallest response body respMaybeCompress will
+// bother compressing; most server-list responses are well above this, but
+// small JSON error bodies aren't worth the CPU.
+const compressMinSize = 512
+
+// compressMinRatio is the largest compressed/uncompressed size ratio for
+// which the compressed body is still used.
+const compressMinRatio = 0.8
+
+var gzipWriterPool = sync.Pool{
+	New: func() any { return gzip.NewWriter(nil) },
+}
+
+var brotliWriterPool = sync.Pool{
+	New: func() any { return brotli.NewWriter(nil) },
+}
+
+var zstdEncoderPool = sync.Pool{
+	New: func() any {
+		enc, err := zstd.NewWriter(nil)
+		if err != nil {
+			panic(err)
+		}
+		return enc
+	},
+}
+
+// encoding identifies a supported Content-Encoding, ordered by preference
+// (lowest index wins a q-value tie).
+type encoding struct {
+	name     string
+	compress func([]byte) []byte
+}
+
+var encodings = []encoding{
+	{"zstd", compressZstd},
+	{"br", compressBrotli},
+	{"gzip", compressGzip},
+}
+
+func compressZstd(buf []byte) []byte {
+	enc := zstdEncoderPool.Get().(*zstd.Encoder)
+	defer zstdEncoderPool.Put(enc)
+	var cbuf bytes.Buffer
+	enc.Reset(&cbuf)
+	if _, err := enc.Write(buf); err != nil {
+		return nil
+	}
+	if err := enc.Close(); err != nil {
+		return nil
+	}
+	return cbuf.Bytes()
+}
+
+func compressBrotli(buf []byte) []byte {
+	bw := brotliWriterPool.Get().(*brotli.Writer)
+	defer brotliWriterPool.Put(bw)
+	var cbuf bytes.Buffer
+	bw.Reset(&cbuf)
+	if _, err := bw.Write(buf); err != nil {
+		return nil
+	}
+	if err := bw.Close(); err != nil {
+		return nil
+	}
+	return cbuf.Bytes()
+}
+
+func compressGzip(buf []byte) []byte {
+	gw := gzipWriterPool.Get().(*gzip.Writer)
+	defer gzipWriterPool.Put(gw)
+	var cbuf bytes.Buffer
+	gw.Reset(&cbuf)
+	if _, err := gw.Write(buf); err != nil {
+		return nil
+	}
+	if err := gw.Close(); err != nil {
+		return nil
+	}
+	return cbuf.Bytes()
+}
+
+// negotiateEncoding parses an Accept-Encoding header per RFC 9110 §12.5.3
+// and returns the most preferred mutually-supported encoding, or "" if none
+// is acceptable (including the client explicitly forbidding everything we
+// support with "*;q=0").
+func negotiateEncoding(acceptEncoding string) string {
+	if acceptEncoding == "" {
+		return ""
+	}
+
+	q := make(map[string]float64, len(encodings))
+	var wildcard float64 = -1
+
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		weight := 1.0
+		if _, v, ok := strings.Cut(params, "="); ok {
+			if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				weight = f
+			}
+		}
+
+		if name == "*" {
+			wildcard = weight
+			continue
+		}
+		q[name] = weight
+	}
+
+	var best string
+	var bestWeight float64
+	for _, e := range encodings {
+		w, ok := q[e.name]
+		if !ok {
+			if wildcard < 0 {
+				continue
+			}
+			w = wildcard
+		}
+		if w <= 0 {
+			continue
+		}
+		if best == "" || w > bestWeight {
+			best, bestWeight = e.name, w
+		}
+	}
+	return best
+}
+
+func encodingCompressor(name string) func([]byte) []byte {
+	for _, e := range encodings {
+		if e.name == name {
+			return e.compress
+		}
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package api0
+
+import "testing"
+
+func TestNegotiateEncoding(t *testing.T) {
+	cases := []struct {
+		name   string
+		accept string
+		want   string
+	}{
+		{"empty", "", ""},
+		{"single", "gzip", "gzip"},
+		{"prefers zstd over br over gzip on tie", "gzip, br, zstd", "zstd"},
+		{"explicit q values pick highest", "gzip;q=0.9, br;q=0.5, zstd;q=0.1", "gzip"},
+		{"zero weight is excluded", "zstd;q=0, br", "br"},
+		{"wildcard fills in missing entries", "*;q=0.3", "zstd"},
+		{"explicit entry overrides wildcard", "*;q=0.3, br;q=0.9", "br"},
+		{"wildcard zero forbids unlisted encodings", "*;q=0, gzip;q=0.5", "gzip"},
+		{"wildcard zero with nothing else acceptable", "*;q=0", ""},
+		{"unsupported encoding only", "identity", ""},
+		{"unparseable q value falls back to 1", "gzip;q=bogus", "gzip"},
+		{"whitespace and case are normalized", " GZIP ; q=1.0 , Br", "br"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := negotiateEncoding(c.accept); got != c.want {
+				t.Errorf("negotiateEncoding(%q) = %q, want %q", c.accept, got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package api0
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/r2northstar/atlas/pkg/api/api0/ratelimit"
+)
+
+// RateLimitPolicy rate-limits requests whose path matches Pattern (a glob
+// supporting a single trailing "*", e.g. "/player/*") to Rate per client.
+type RateLimitPolicy struct {
+	Pattern string
+	Rate    ratelimit.Rate
+}
+
+func (p RateLimitPolicy) match(path string) bool {
+	if prefix, ok := strings.CutSuffix(p.Pattern, "*"); ok {
+		return strings.HasPrefix(path, prefix)
+	}
+	return path == p.Pattern
+}
+
+// RateLimits configures request rate limiting for Handler.ServeHTTP.
+type RateLimits struct {
+	// Limiter enforces the configured Policies. A nil Limiter disables rate
+	// limiting entirely.
+	Limiter ratelimit.Limiter
+	// Policies are tried in order; the first matching Pattern applies.
+	Policies []RateLimitPolicy
+	// Bypass, if set, skips rate limiting entirely for a client IP (e.g. for
+	// known game server hosts or dev).
+	Bypass func(ip string) bool
+}
+
+// checkRateLimit enforces h.RateLimits for r, writing a 429 response and
+// returning false if the request must be rejected.
+func (h *Handler) checkRateLimit(w http.ResponseWriter, r *http.Request) bool {
+	rl := h.RateLimits
+	if rl == nil || rl.Limiter == nil {
+		return true
+	}
+
+	var policy *RateLimitPolicy
+	for i := range rl.Policies {
+		if rl.Policies[i].match(r.URL.Path) {
+			policy = &rl.Policies[i]
+			break
+		}
+	}
+	if policy == nil {
+		return true
+	}
+
+	ip := clientIP(r)
+	if rl.Bypass != nil && rl.Bypass(ip) {
+		return true
+	}
+
+	ok, wait, err := rl.Limiter.Allow(r.Context(), policy.Pattern, ip, policy.Rate)
+	if err != nil {
+		// Fail open: a rate limiter outage (e.g. Redis down) shouldn't take
+		// the whole API down with it.
+		return true
+	}
+	if ok {
+		return true
+	}
+
+	metrics.GetOrCreateCounter(`atlas_api0_ratelimit_rejected_total{route=` + strconv.Quote(policy.Pattern) + `}`).Inc()
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+	return false
+}
+
+// clientIP returns the client IP from r.RemoteAddr, which by the time it
+// reaches api0 has already been rewritten to the trusted client address by
+// the proxy-header middleware (see pkg/trustedproxy), not the raw TCP peer.
+func clientIP(r *http.Request) string {
+	if h, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return h
+	}
+	return r.RemoteAddr
+}
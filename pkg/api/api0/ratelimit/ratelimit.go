@@ -0,0 +1,113 @@
+// Package ratelimit implements rate limiting for pkg/api/api0, replacing
+// the rate limits removed from the original implementation (see the api0
+// package doc comment) with a structured, per-route, pluggable scheme.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Rate is a token-bucket rate limit: up to Burst requests may be made
+// instantly, refilling at PerSecond tokens per second thereafter.
+type Rate struct {
+	PerSecond float64
+	Burst     int
+}
+
+// ParseRate parses a "rate/burst" string, e.g. "5/10" for 5 requests/second
+// with bursts up to 10, as used in the API0_RateLimits config map.
+func ParseRate(s string) (Rate, error) {
+	var r Rate
+	if _, err := fmt.Sscanf(s, "%f/%d", &r.PerSecond, &r.Burst); err != nil {
+		return Rate{}, fmt.Errorf("invalid rate %q: expected format \"rate/burst\"", s)
+	}
+	if r.PerSecond <= 0 || r.Burst <= 0 {
+		return Rate{}, fmt.Errorf("invalid rate %q: rate and burst must be positive", s)
+	}
+	return r, nil
+}
+
+// Limiter decides whether a request for a given route and key (usually the
+// trusted client IP) is currently allowed.
+type Limiter interface {
+	// Allow reports whether a request is permitted right now. If not, wait
+	// is how long the caller should tell the client to retry after.
+	Allow(ctx context.Context, route string, key string, rate Rate) (ok bool, wait time.Duration, err error)
+}
+
+// Memory is an in-memory, per-process token-bucket Limiter.
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+// sweepInterval is how often NewMemory's background goroutine calls Sweep,
+// and sweepMaxIdle is the idle threshold it sweeps with.
+const (
+	sweepInterval = 10 * time.Minute
+	sweepMaxIdle  = 10 * time.Minute
+)
+
+// NewMemory returns a ready-to-use in-memory Limiter. It starts a background
+// goroutine that periodically sweeps idle buckets so buckets does not grow
+// without bound for the lifetime of the process.
+func NewMemory() *Memory {
+	m := &Memory{buckets: make(map[string]*bucket)}
+	go func() {
+		for range time.Tick(sweepInterval) {
+			m.Sweep(sweepMaxIdle)
+		}
+	}()
+	return m
+}
+
+var _ Limiter = (*Memory)(nil)
+
+func (m *Memory) Allow(_ context.Context, route, key string, rate Rate) (bool, time.Duration, error) {
+	now := time.Now()
+	k := route + "\x00" + key
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, ok := m.buckets[k]
+	if !ok {
+		b = &bucket{tokens: float64(rate.Burst), lastSeen: now}
+		m.buckets[k] = b
+	} else {
+		b.tokens += now.Sub(b.lastSeen).Seconds() * rate.PerSecond
+		if b.tokens > float64(rate.Burst) {
+			b.tokens = float64(rate.Burst)
+		}
+		b.lastSeen = now
+	}
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / rate.PerSecond * float64(time.Second))
+		return false, wait, nil
+	}
+	b.tokens--
+	return true, 0, nil
+}
+
+// Sweep removes buckets that have been idle for longer than maxIdle, to
+// bound memory use. NewMemory's background goroutine runs it every
+// sweepInterval.
+func (m *Memory) Sweep(maxIdle time.Duration) {
+	cutoff := time.Now().Add(-maxIdle)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for k, b := range m.buckets {
+		if b.lastSeen.Before(cutoff) {
+			delete(m.buckets, k)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    Rate
+		wantErr bool
+	}{
+		{"5/10", Rate{PerSecond: 5, Burst: 10}, false},
+		{"0.5/1", Rate{PerSecond: 0.5, Burst: 1}, false},
+		{"bogus", Rate{}, true},
+		{"5", Rate{}, true},
+		{"-5/10", Rate{}, true},
+		{"5/0", Rate{}, true},
+	}
+	for _, c := range cases {
+		got, err := ParseRate(c.in)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("ParseRate(%q): expected error, got %+v", c.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseRate(%q): unexpected error: %v", c.in, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("ParseRate(%q) = %+v, want %+v", c.in, got, c.want)
+		}
+	}
+}
+
+func TestMemoryAllowBurstAndRefill(t *testing.T) {
+	m := NewMemory()
+	rate := Rate{PerSecond: 1, Burst: 2}
+
+	for i := 0; i < rate.Burst; i++ {
+		ok, _, err := m.Allow(context.Background(), "/route", "key", rate)
+		if err != nil {
+			t.Fatalf("Allow: %v", err)
+		}
+		if !ok {
+			t.Fatalf("request %d: expected burst request to be allowed", i)
+		}
+	}
+
+	ok, wait, err := m.Allow(context.Background(), "/route", "key", rate)
+	if err != nil {
+		t.Fatalf("Allow: %v", err)
+	}
+	if ok {
+		t.Fatal("expected burst to be exhausted")
+	}
+	if wait <= 0 {
+		t.Fatalf("expected a positive retry-after wait, got %v", wait)
+	}
+
+	// Pretend a second has passed since the rejected request; at 1 token/s
+	// that refills one token.
+	m.mu.Lock()
+	m.buckets["/route\x00key"].lastSeen = m.buckets["/route\x00key"].lastSeen.Add(-time.Second)
+	m.mu.Unlock()
+
+	ok, _, err = m.Allow(context.Background(), "/route", "key", rate)
+	if err != nil {
+		t.Fatalf("Allow: %v", err)
+	}
+	if !ok {
+		t.Fatal("expected a request to be allowed once the bucket refilled")
+	}
+}
+
+func TestMemoryAllowPerKeyAndRouteIsolation(t *testing.T) {
+	m := NewMemory()
+	rate := Rate{PerSecond: 1, Burst: 1}
+
+	if ok, _, err := m.Allow(context.Background(), "/route", "a", rate); err != nil || !ok {
+		t.Fatalf("first request for key a: ok=%v err=%v", ok, err)
+	}
+	if ok, _, err := m.Allow(context.Background(), "/route", "b", rate); err != nil || !ok {
+		t.Fatalf("first request for key b should not share a's bucket: ok=%v err=%v", ok, err)
+	}
+	if ok, _, err := m.Allow(context.Background(), "/other-route", "a", rate); err != nil || !ok {
+		t.Fatalf("first request for a different route should not share a's bucket: ok=%v err=%v", ok, err)
+	}
+}
+
+func TestMemorySweep(t *testing.T) {
+	m := NewMemory()
+	rate := Rate{PerSecond: 1, Burst: 1}
+	if _, _, err := m.Allow(context.Background(), "/route", "idle", rate); err != nil {
+		t.Fatalf("Allow: %v", err)
+	}
+
+	m.mu.Lock()
+	m.buckets["/route\x00idle"].lastSeen = time.Now().Add(-time.Hour)
+	n := len(m.buckets)
+	m.mu.Unlock()
+	if n != 1 {
+		t.Fatalf("expected 1 bucket before sweep, got %d", n)
+	}
+
+	m.Sweep(time.Minute)
+
+	m.mu.Lock()
+	n = len(m.buckets)
+	m.mu.Unlock()
+	if n != 0 {
+		t.Fatalf("expected Sweep to remove the idle bucket, got %d remaining", n)
+	}
+}
@@ -0,0 +1,54 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis is a Limiter backed by Redis, sharing counters across every Atlas
+// node. It implements a fixed-window counter rather than a true token
+// bucket (INCR has no notion of gradual refill): each (route, key) pair
+// gets one counter per window, sized so the window holds Burst requests at
+// PerSecond, incremented with INCR and given a TTL with EXPIRE on its first
+// use in that window.
+type Redis struct {
+	rdb *redis.Client
+}
+
+var _ Limiter = (*Redis)(nil)
+
+// NewRedis returns a Limiter using rdb for its counters.
+func NewRedis(rdb *redis.Client) *Redis {
+	return &Redis{rdb: rdb}
+}
+
+func (l *Redis) Allow(ctx context.Context, route, key string, rate Rate) (bool, time.Duration, error) {
+	window := time.Duration(float64(rate.Burst) / rate.PerSecond * float64(time.Second))
+	if window <= 0 {
+		window = time.Second
+	}
+	slot := time.Now().UnixNano() / window.Nanoseconds()
+	k := fmt.Sprintf("atlas:ratelimit:%s:%s:%d", route, key, slot)
+
+	n, err := l.rdb.Incr(ctx, k).Result()
+	if err != nil {
+		return false, 0, fmt.Errorf("redis: incr: %w", err)
+	}
+	if n == 1 {
+		if err := l.rdb.Expire(ctx, k, window).Err(); err != nil {
+			return false, 0, fmt.Errorf("redis: expire: %w", err)
+		}
+	}
+
+	if n > int64(rate.Burst) {
+		wait := time.Duration((slot+1)*window.Nanoseconds()) - time.Duration(time.Now().UnixNano())
+		if wait < 0 {
+			wait = 0
+		}
+		return false, wait, nil
+	}
+	return true, 0, nil
+}
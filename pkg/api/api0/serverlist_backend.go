@@ -0,0 +1,47 @@
+package api0
+
+import (
+	"context"
+	"time"
+)
+
+// ServerListBackend stores the set of registered game servers and is
+// responsible for notifying the local ServerList of changes made by other
+// Atlas instances, allowing NewServerList to be backed by something other
+// than process-local memory (see memServerListBackend and the
+// pkg/redisserverlist package).
+type ServerListBackend interface {
+	// Add registers srv, replacing any existing server with the same Id.
+	Add(ctx context.Context, srv *GameServer) error
+
+	// Update atomically applies fn to the stored server with the provided
+	// id, if any, and persists the result. It returns false if no such
+	// server exists.
+	Update(ctx context.Context, id string, fn func(*GameServer)) (bool, error)
+
+	// Remove deletes the server with the provided id, if any.
+	Remove(ctx context.Context, id string) error
+
+	// List returns all non-expired servers.
+	List(ctx context.Context) ([]*GameServer, error)
+
+	// Heartbeat refreshes the liveness deadline for the server with the
+	// provided id, returning false if no such server exists.
+	Heartbeat(ctx context.Context, id string, deadTime time.Duration) (bool, error)
+
+	// CountByIP returns the number of currently-registered servers whose
+	// source IP matches ip, for enforcing MaxServersPerIP.
+	CountByIP(ctx context.Context, ip string) (int, error)
+}
+
+// NewServerListWithBackend is like NewServerList, but stores servers in
+// backend instead of process-local memory, allowing multiple Atlas
+// instances to share one list. A nil backend keeps the previous
+// in-process-memory behavior of NewServerList.
+func NewServerListWithBackend(backend ServerListBackend, deadTime, ghostTime, verifyTime time.Duration) *ServerList {
+	sl := NewServerList(deadTime, ghostTime, verifyTime)
+	if backend != nil {
+		sl.backend = backend
+	}
+	return sl
+}
@@ -0,0 +1,145 @@
+package atlas
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"path/filepath"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/rs/zerolog"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// configureServerTLS builds the *tls.Config used for AddrTLS listeners, and
+// (if ACME is configured) the HTTP-01 challenge handler to mount on the
+// plain Addr listeners. Static certificates from ServerCerts always take
+// precedence over ACME-issued ones for the SNIs they cover; anything else
+// falls through to ACME (HTTP-01 and TLS-ALPN-01) when configured.
+func configureServerTLS(c *Config, l zerolog.Logger, fallback http.Handler) (*tls.Config, http.Handler, error) {
+	static, err := loadServerCerts(c.ServerCerts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if c.ACME.Email == "" && len(static) == 0 {
+		if len(c.AddrTLS) != 0 {
+			return nil, nil, fmt.Errorf("no tls certificates provided")
+		}
+		return &tls.Config{}, nil, nil
+	}
+
+	var mgr *autocert.Manager
+	if c.ACME.Email != "" {
+		directory := c.ACME.DirectoryURL
+		if directory == "" {
+			directory = acme.LetsEncryptURL
+		}
+		mgr = &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			Cache:      autocert.DirCache(c.ACME.CacheDir),
+			Email:      c.ACME.Email,
+			Client:     &acme.Client{DirectoryURL: directory},
+			HostPolicy: acmeHostPolicy(c.ACME.Host),
+		}
+	}
+
+	t := &tls.Config{
+		NextProtos: []string{"h2", "http/1.1"},
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if mgr != nil && isACMEChallenge(hello) {
+				return mgr.GetCertificate(hello)
+			}
+			if cert, ok := matchServerCert(static, hello.ServerName); ok {
+				return cert, nil
+			}
+			if mgr != nil {
+				cert, err := mgr.GetCertificate(hello)
+				if err != nil {
+					metrics.GetOrCreateCounter(`atlas_tls_acme_renewal_errors_total`).Inc()
+					l.Err(err).Str("component", "tls").Str("sni", hello.ServerName).Msg("acme: failed to obtain certificate")
+					return nil, err
+				}
+				metrics.GetOrCreateCounter(`atlas_tls_acme_renewal_success_total`).Inc()
+				return cert, nil
+			}
+			if len(static) != 0 {
+				// No ACME manager configured, so behave like the stdlib
+				// default for an unmatched/missing SNI: fall back to the
+				// first configured certificate instead of aborting the
+				// handshake.
+				return static[0], nil
+			}
+			return nil, fmt.Errorf("no certificate available for %q", hello.ServerName)
+		},
+	}
+
+	var challengeHandler http.Handler
+	if mgr != nil {
+		t.NextProtos = append(t.NextProtos, acme.ALPNProto)
+		challengeHandler = mgr.HTTPHandler(fallback)
+	}
+	return t, challengeHandler, nil
+}
+
+func loadServerCerts(fns []string) ([]*tls.Certificate, error) {
+	var certs []*tls.Certificate
+	for _, fn := range fns {
+		p, err := filepath.Abs(fn)
+		if err != nil {
+			return nil, fmt.Errorf("resolve server certificate %q: %w", fn, err)
+		}
+		cert, err := tls.LoadX509KeyPair(p+".crt", p+".key")
+		if err != nil {
+			return nil, fmt.Errorf("load server certificate %q: %w", fn, err)
+		}
+		if cert.Leaf == nil {
+			leaf, err := x509.ParseCertificate(cert.Certificate[0])
+			if err != nil {
+				return nil, fmt.Errorf("parse server certificate %q: %w", fn, err)
+			}
+			cert.Leaf = leaf
+		}
+		certs = append(certs, &cert)
+	}
+	return certs, nil
+}
+
+// matchServerCert returns the first static certificate whose leaf matches
+// name (exactly or via wildcard), like tls.Config's own SNI matching.
+func matchServerCert(certs []*tls.Certificate, name string) (*tls.Certificate, bool) {
+	for _, cert := range certs {
+		if err := cert.Leaf.VerifyHostname(name); err == nil {
+			return cert, true
+		}
+	}
+	if len(certs) != 0 && name == "" {
+		return certs[0], true
+	}
+	return nil, false
+}
+
+// acmeHostPolicy restricts certificate issuance to the configured hosts, or
+// allows any host if none are configured (e.g. when relying on DNS-based
+// routing rather than a fixed host list).
+func acmeHostPolicy(hosts []string) autocert.HostPolicy {
+	if len(hosts) == 0 {
+		return func(context.Context, string) error { return nil }
+	}
+	return autocert.HostWhitelist(hosts...)
+}
+
+// isACMEChallenge reports whether hello is a TLS-ALPN-01 challenge handshake,
+// which must always be handled by ACME regardless of any static certificate
+// for the same name.
+func isACMEChallenge(hello *tls.ClientHelloInfo) bool {
+	for _, p := range hello.SupportedProtos {
+		if p == acme.ALPNProto {
+			return true
+		}
+	}
+	return false
+}
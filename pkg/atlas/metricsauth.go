@@ -0,0 +1,79 @@
+package atlas
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// configureMetricsClientAuth loads c.MetricsClientCA (if set) and, if t is
+// non-nil, attaches a VerifyConnection callback that rejects any presented
+// client certificate not signed by that CA. It does not require a client
+// certificate (ClientAuth stays RequestClientCert), so regular API traffic
+// on the same listener is unaffected; serveRest decides whether a given
+// request is authorized for internal metrics via metricsClientAllowed.
+func configureMetricsClientAuth(c *Config, t *tls.Config) (*x509.CertPool, error) {
+	if c.MetricsClientCA == "" {
+		return nil, nil
+	}
+	if len(c.AddrTLS) == 0 {
+		return nil, fmt.Errorf("MetricsClientCA requires at least one AddrTLS listener")
+	}
+
+	pem, err := os.ReadFile(c.MetricsClientCA)
+	if err != nil {
+		return nil, fmt.Errorf("read metrics client ca: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("read metrics client ca: no certificates found in %q", c.MetricsClientCA)
+	}
+	if t == nil {
+		return pool, nil
+	}
+
+	t.ClientAuth = tls.RequestClientCert
+	t.VerifyConnection = func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return nil // no client cert presented; not a metrics client, let regular API traffic through
+		}
+		opts := x509.VerifyOptions{
+			Roots:         pool,
+			Intermediates: x509.NewCertPool(),
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}
+		for _, c := range cs.PeerCertificates[1:] {
+			opts.Intermediates.AddCert(c)
+		}
+		if _, err := cs.PeerCertificates[0].Verify(opts); err != nil {
+			return fmt.Errorf("verify metrics client certificate: %w", err)
+		}
+		return nil
+	}
+	return pool, nil
+}
+
+// metricsClientAllowed reports whether r arrived over TLS with a client
+// certificate that verified against MetricsClientCA (configureMetricsClientAuth
+// already rejected the connection if it didn't) and whose CN or a SAN
+// matches MetricsClientAllowedNames.
+func (s *Server) metricsClientAllowed(r *http.Request) bool {
+	if s.metricsClientCA == nil || r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return false
+	}
+	if len(s.MetricsClientAllowedNames) == 0 {
+		return true
+	}
+	cert := r.TLS.PeerCertificates[0]
+	names := append([]string{cert.Subject.CommonName}, append(cert.DNSNames, cert.EmailAddresses...)...)
+	for _, allowed := range s.MetricsClientAllowedNames {
+		for _, n := range names {
+			if n == allowed {
+				return true
+			}
+		}
+	}
+	return false
+}
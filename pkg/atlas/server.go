@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -14,18 +15,26 @@ import (
 	"net/netip"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/VictoriaMetrics/metrics"
+	"github.com/pires/go-proxyproto"
 	"github.com/r2northstar/atlas/db/atlasdb"
+	"github.com/r2northstar/atlas/db/atlaspg"
 	"github.com/r2northstar/atlas/db/pdatadb"
+	"github.com/r2northstar/atlas/db/pdatapg"
 	"github.com/r2northstar/atlas/pkg/api/api0"
+	"github.com/r2northstar/atlas/pkg/api/api0/ratelimit"
 	"github.com/r2northstar/atlas/pkg/cloudflare"
 	"github.com/r2northstar/atlas/pkg/memstore"
 	"github.com/r2northstar/atlas/pkg/origin"
+	"github.com/r2northstar/atlas/pkg/redisserverlist"
+	"github.com/r2northstar/atlas/pkg/trustedproxy"
+	"github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/hlog"
 	"golang.org/x/mod/semver"
@@ -34,19 +43,24 @@ import (
 type Server struct {
 	Logger zerolog.Logger
 
-	Addr          []string
-	AddrTLS       []string
-	Handler       http.Handler
-	Web           http.Handler
-	Redirects     map[string]string
-	NotifySocket  string
-	MetricsSecret string
-	API0          *api0.Handler
-	Middleware    []func(http.Handler) http.Handler
-	TLSConfig     *tls.Config
-
-	reload []func()
-	closed bool
+	Addr                      []string
+	AddrTLS                   []string
+	ProxyProtocol             int            // 0 (disabled), 1, or 2; expects listener-level PROXY protocol headers, per TrustedProxies.Mode == "proxy-protocol"
+	ProxyProtocolCIDRs        []netip.Prefix // peers allowed to send a PROXY protocol header
+	Handler                   http.Handler
+	ACMEChallengeHandler      http.Handler // handles ACME HTTP-01 challenges on Addr listeners; non-challenge requests fall through to Handler
+	Web                       http.Handler
+	Redirects                 map[string]string
+	NotifySocket              string
+	MetricsSecret             string
+	MetricsClientAllowedNames []string // CN/SAN allow-list for MetricsClientCA auth
+	API0                      *api0.Handler
+	Middleware                []func(http.Handler) http.Handler
+	TLSConfig                 *tls.Config
+
+	reload          []func()
+	closed          bool
+	metricsClientCA *x509.CertPool
 }
 
 // NewServer configures a new server using c, which is assumed to be initialized
@@ -63,6 +77,20 @@ func NewServer(c *Config) (*Server, error) {
 	s.Addr = c.Addr
 	s.AddrTLS = c.AddrTLS
 
+	switch c.TrustedProxies.Mode {
+	case "proxy-protocol", "proxy-protocol-v1":
+		s.ProxyProtocol = 1
+	case "proxy-protocol-v2":
+		s.ProxyProtocol = 2
+	}
+	if s.ProxyProtocol != 0 {
+		cidrs, err := parseCIDRs(c.TrustedProxies.CIDRs)
+		if err != nil {
+			return nil, fmt.Errorf("initialize trusted proxies: %w", err)
+		}
+		s.ProxyProtocolCIDRs = cidrs
+	}
+
 	s.NotifySocket = c.NotifySocket
 
 	if c.Web != "" {
@@ -170,18 +198,10 @@ func NewServer(c *Config) (*Server, error) {
 		})
 	}
 
-	if c.Cloudflare {
-		m.Add(cloudflare.RealIP(func(r *http.Request, err error) {
-			e := s.Logger.Warn()
-			if rid, ok := hlog.IDFromRequest(r); ok {
-				e = e.Stringer("rid", rid)
-			}
-			e.
-				Err(err).
-				Str("component", "http").
-				Str("request_ip", r.RemoteAddr).
-				Msg("use cloudflare ip")
-		}))
+	if fn, err := configureTrustedProxies(c, s.Logger); err != nil {
+		return nil, fmt.Errorf("initialize trusted proxies: %w", err)
+	} else if fn != nil {
+		m.Add(fn)
 	}
 
 	m.Add(hlog.AccessHandler(func(r *http.Request, status, size int, duration time.Duration) {
@@ -209,8 +229,13 @@ func NewServer(c *Config) (*Server, error) {
 	m.Add(hlog.NewHandler(s.Logger.With().Str("component", "api0").Logger()))
 	m.Add(hlog.RequestIDHandler("rid", ""))
 
+	slBackend, err := configureServerListBackend(c)
+	if err != nil {
+		return nil, fmt.Errorf("initialize server list backend: %w", err)
+	}
+
 	s.API0 = &api0.Handler{
-		ServerList:                   api0.NewServerList(c.API0_ServerList_DeadTime, c.API0_ServerList_GhostTime, c.API0_ServerList_VerifyTime),
+		ServerList:                   api0.NewServerListWithBackend(slBackend, c.API0_ServerList_DeadTime, c.API0_ServerList_GhostTime, c.API0_ServerList_VerifyTime),
 		OriginAuthMgr:                configureOrigin(c, s.Logger.With().Str("component", "origin").Logger()),
 		MaxServers:                   c.API0_MaxServers,
 		MaxServersPerIP:              c.API0_MaxServersPerIP,
@@ -240,51 +265,34 @@ func NewServer(c *Config) (*Server, error) {
 	} else {
 		return nil, fmt.Errorf("initialize main menu promos: %w", err)
 	}
+	if rl, err := configureRateLimits(c); err == nil {
+		s.API0.RateLimits = rl
+	} else {
+		return nil, fmt.Errorf("initialize rate limits: %w", err)
+	}
 
 	s.MetricsSecret = c.MetricsSecret
 
 	s.Handler = m.Then(s.API0)
 
-	if cfg, err := configureServerTLS(c); err == nil {
+	if cfg, challenge, err := configureServerTLS(c, s.Logger.With().Str("component", "tls").Logger(), s.Handler); err == nil {
 		s.TLSConfig = cfg
+		s.ACMEChallengeHandler = challenge
 	} else {
 		return nil, fmt.Errorf("initialize server tls: %w", err)
 	}
 
-	if len(c.ServerCerts) != 0 {
-		var certs []tls.Certificate
-		for _, fn := range c.ServerCerts {
-			cert, err := tls.LoadX509KeyPair(fn+".crt", fn+".key")
-			if err != nil {
-				return nil, fmt.Errorf("load server certificate %q: %w", fn, err)
-			}
-			certs = append(certs, cert)
-		}
-		s.TLSConfig = &tls.Config{
-			Certificates: certs,
-		}
+	if pool, err := configureMetricsClientAuth(c, s.TLSConfig); err == nil {
+		s.metricsClientCA = pool
+		s.MetricsClientAllowedNames = c.MetricsClientAllowedNames
+	} else {
+		return nil, fmt.Errorf("initialize metrics client auth: %w", err)
 	}
 
 	success = true
 	return &s, nil
 }
 
-func configureServerTLS(c *Config) (*tls.Config, error) {
-	var t tls.Config
-	if len(c.ServerCerts) != 0 {
-		for _, fn := range c.ServerCerts {
-			cert, err := tls.LoadX509KeyPair(fn+".crt", fn+".key")
-			if err != nil {
-				return nil, fmt.Errorf("load server certificate %q: %w", fn, err)
-			}
-			t.Certificates = append(t.Certificates, cert)
-		}
-	} else if len(c.AddrTLS) != 0 {
-		return nil, fmt.Errorf("no tls certificates provided")
-	}
-	return &t, nil
-}
-
 func configureDevMapIP(c *Config) (func(http.Handler) http.Handler, error) {
 	if len(c.DevMapIP) == 0 {
 		return nil, nil
@@ -337,6 +345,63 @@ func configureDevMapIP(c *Config) (func(http.Handler) http.Handler, error) {
 	}, nil
 }
 
+// configureTrustedProxies builds the middleware that recovers the real
+// client IP from a trusted reverse proxy, per c.TrustedProxies. Mode
+// "cloudflare" is a preset that keeps cloudflare's published ranges fresh and
+// reads CF-Connecting-IP; it goes through the same middleware shape (and the
+// same DevMapIP interaction: DevMapIP runs first in the chain, so a mapped
+// IP is what gets checked against the trusted CIDRs here, letting tests fake
+// requests "from" a trusted proxy) as the other, CIDR-configured modes.
+func configureTrustedProxies(c *Config, l zerolog.Logger) (func(http.Handler) http.Handler, error) {
+	onError := func(r *http.Request, err error) {
+		e := l.Warn()
+		if rid, ok := hlog.IDFromRequest(r); ok {
+			e = e.Stringer("rid", rid)
+		}
+		e.
+			Err(err).
+			Str("component", "http").
+			Str("request_ip", r.RemoteAddr).
+			Msg("use trusted proxy ip")
+	}
+
+	if c.TrustedProxies.Mode == "cloudflare" || (c.TrustedProxies.Mode == "" && c.Cloudflare) {
+		return cloudflare.RealIP(onError), nil
+	}
+	if c.TrustedProxies.Mode == "" {
+		return nil, nil
+	}
+	switch c.TrustedProxies.Mode {
+	case "proxy-protocol", "proxy-protocol-v1", "proxy-protocol-v2":
+		// The real address is already recovered at the TCP layer by
+		// proxyProtocolPolicy/proxyproto.Listener; no HTTP middleware needed.
+		return nil, nil
+	}
+
+	cidrs, err := parseCIDRs(c.TrustedProxies.CIDRs)
+	if err != nil {
+		return nil, err
+	}
+
+	return trustedproxy.New(trustedproxy.Config{
+		CIDRs:   cidrs,
+		Mode:    trustedproxy.Mode(c.TrustedProxies.Mode),
+		OnError: onError,
+	})
+}
+
+func parseCIDRs(ss []string) ([]netip.Prefix, error) {
+	var cidrs []netip.Prefix
+	for _, s := range ss {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("parse trusted proxy cidr %q: %w", s, err)
+		}
+		cidrs = append(cidrs, p)
+	}
+	return cidrs, nil
+}
+
 func configureLogging(c *Config) (l zerolog.Logger, reopen func(), err error) {
 	var outputs []io.Writer
 	if c.LogStdout {
@@ -432,6 +497,126 @@ func configureOrigin(c *Config, l zerolog.Logger) *origin.AuthMgr {
 	return mgr
 }
 
+// configureServerListBackend selects the api0.ServerListBackend to use, based
+// on c.API0_ServerList_Backend. A nil backend means api0.NewServerListWithBackend
+// should fall back to its built-in in-memory implementation.
+func configureServerListBackend(c *Config) (api0.ServerListBackend, error) {
+	switch typ, arg, _ := strings.Cut(c.API0_ServerList_Backend, ":"); typ {
+	case "", "memory":
+		if arg != "" {
+			return nil, fmt.Errorf("memory: invalid argument %q", arg)
+		}
+		return nil, nil
+	case "redis":
+		rdb := redis.NewClient(&redis.Options{Addr: arg})
+		if err := rdb.Ping(context.Background()).Err(); err != nil {
+			return nil, fmt.Errorf("redis: connect: %w", err)
+		}
+		return instrumentedServerListBackend{redisserverlist.New(rdb, c.API0_ServerList_DeadTime)}, nil
+	default:
+		return nil, fmt.Errorf("unknown type %q", typ)
+	}
+}
+
+// instrumentedServerListBackend wraps an api0.ServerListBackend to expose
+// per-call latency as Prometheus histograms, surfaced through WritePrometheus.
+type instrumentedServerListBackend struct {
+	api0.ServerListBackend
+}
+
+func (b instrumentedServerListBackend) observe(op string, start time.Time) {
+	metrics.GetOrCreateHistogram(fmt.Sprintf("atlas_serverlist_backend_duration_seconds{op=%q}", op)).
+		Update(time.Since(start).Seconds())
+}
+
+func (b instrumentedServerListBackend) Add(ctx context.Context, srv *api0.GameServer) error {
+	defer b.observe("add", time.Now())
+	return b.ServerListBackend.Add(ctx, srv)
+}
+
+func (b instrumentedServerListBackend) Update(ctx context.Context, id string, fn func(*api0.GameServer)) (bool, error) {
+	defer b.observe("update", time.Now())
+	return b.ServerListBackend.Update(ctx, id, fn)
+}
+
+func (b instrumentedServerListBackend) Remove(ctx context.Context, id string) error {
+	defer b.observe("remove", time.Now())
+	return b.ServerListBackend.Remove(ctx, id)
+}
+
+func (b instrumentedServerListBackend) List(ctx context.Context) ([]*api0.GameServer, error) {
+	defer b.observe("list", time.Now())
+	return b.ServerListBackend.List(ctx)
+}
+
+func (b instrumentedServerListBackend) Heartbeat(ctx context.Context, id string, deadTime time.Duration) (bool, error) {
+	defer b.observe("heartbeat", time.Now())
+	return b.ServerListBackend.Heartbeat(ctx, id, deadTime)
+}
+
+func (b instrumentedServerListBackend) CountByIP(ctx context.Context, ip string) (int, error) {
+	defer b.observe("count_by_ip", time.Now())
+	return b.ServerListBackend.CountByIP(ctx, ip)
+}
+
+// configureRateLimits builds the api0.RateLimits from c.API0_RateLimits (a
+// route-glob -> "rate/burst" map) and c.API0_RateLimits_Backend, which
+// selects "memory" (the default, a process-local token bucket) or
+// "redis:<addr>" (a fixed-window counter shared by every Atlas node).
+func configureRateLimits(c *Config) (*api0.RateLimits, error) {
+	if len(c.API0_RateLimits) == 0 {
+		return nil, nil
+	}
+
+	policies := make([]api0.RateLimitPolicy, 0, len(c.API0_RateLimits))
+	for pattern, s := range c.API0_RateLimits {
+		r, err := ratelimit.ParseRate(s)
+		if err != nil {
+			return nil, fmt.Errorf("rate limit %q: %w", pattern, err)
+		}
+		policies = append(policies, api0.RateLimitPolicy{Pattern: pattern, Rate: r})
+	}
+	sort.Slice(policies, func(i, j int) bool {
+		return len(policies[i].Pattern) > len(policies[j].Pattern)
+	})
+
+	var limiter ratelimit.Limiter
+	switch typ, arg, _ := strings.Cut(c.API0_RateLimits_Backend, ":"); typ {
+	case "", "memory":
+		limiter = ratelimit.NewMemory()
+	case "redis":
+		rdb := redis.NewClient(&redis.Options{Addr: arg})
+		if err := rdb.Ping(context.Background()).Err(); err != nil {
+			return nil, fmt.Errorf("redis: connect: %w", err)
+		}
+		limiter = ratelimit.NewRedis(rdb)
+	default:
+		return nil, fmt.Errorf("unknown rate limit backend %q", typ)
+	}
+
+	allow, err := parseCIDRs(c.API0_RateLimits_Allow)
+	if err != nil {
+		return nil, err
+	}
+
+	return &api0.RateLimits{
+		Limiter:  limiter,
+		Policies: policies,
+		Bypass: func(ip string) bool {
+			a, err := netip.ParseAddr(ip)
+			if err != nil {
+				return false
+			}
+			for _, p := range allow {
+				if p.Contains(a) {
+					return true
+				}
+			}
+			return false
+		},
+	}, nil
+}
+
 func configureAccountStorage(c *Config) (api0.AccountStorage, error) {
 	switch typ, arg, _ := strings.Cut(c.API0_Storage_Accounts, ":"); typ {
 	case "memory":
@@ -458,6 +643,21 @@ func configureAccountStorage(c *Config) (api0.AccountStorage, error) {
 			}
 		}
 		return s, nil
+	case "postgres":
+		s, err := atlaspg.Open(arg)
+		if err != nil {
+			return nil, fmt.Errorf("postgres: %w", err)
+		}
+		if cur, to, err := s.Version(); err != nil {
+			return nil, fmt.Errorf("postgres: migrate: %w", err)
+		} else if cur > to {
+			return nil, fmt.Errorf("postgres: migrate: database version %d is too new", cur)
+		} else if cur != to {
+			if err := s.MigrateUp(context.Background(), to); err != nil {
+				return nil, fmt.Errorf("postgres: migrate (%d to %d): %w", cur, to, err)
+			}
+		}
+		return s, nil
 	default:
 		return nil, fmt.Errorf("unknown type %q", typ)
 	}
@@ -493,6 +693,21 @@ func configurePdataStorage(c *Config) (api0.PdataStorage, error) {
 			}
 		}
 		return s, nil
+	case "postgres":
+		s, err := pdatapg.Open(arg)
+		if err != nil {
+			return nil, fmt.Errorf("postgres: %w", err)
+		}
+		if cur, to, err := s.Version(); err != nil {
+			return nil, fmt.Errorf("postgres: migrate: %w", err)
+		} else if cur > to {
+			return nil, fmt.Errorf("postgres: migrate: database version %d is too new", cur)
+		} else if cur != to {
+			if err := s.MigrateUp(context.Background(), to); err != nil {
+				return nil, fmt.Errorf("postgres: migrate (%d to %d): %w", cur, to, err)
+			}
+		}
+		return s, nil
 	default:
 		return nil, fmt.Errorf("unknown type %q", typ)
 	}
@@ -533,11 +748,16 @@ func (s *Server) Run(ctx context.Context) error {
 		return http.ErrServerClosed
 	}
 
+	plainHandler := s.Handler
+	if s.ACMEChallengeHandler != nil {
+		plainHandler = s.ACMEChallengeHandler
+	}
+
 	var hs []*http.Server
 	for _, a := range s.Addr {
 		hs = append(hs, &http.Server{
 			Addr:    a,
-			Handler: s.Handler,
+			Handler: plainHandler,
 		})
 	}
 	for _, a := range s.AddrTLS {
@@ -555,10 +775,27 @@ func (s *Server) Run(ctx context.Context) error {
 	for _, h := range hs {
 		h := h
 		go func() {
+			if s.ProxyProtocol == 0 {
+				if h.TLSConfig != nil {
+					errch <- h.ListenAndServeTLS("", "")
+				} else {
+					errch <- h.ListenAndServe()
+				}
+				return
+			}
+			l, err := net.Listen("tcp", h.Addr)
+			if err != nil {
+				errch <- err
+				return
+			}
+			l = &proxyproto.Listener{
+				Listener: l,
+				Policy:   s.proxyProtocolPolicy,
+			}
 			if h.TLSConfig != nil {
-				errch <- h.ListenAndServeTLS("", "")
+				errch <- h.ServeTLS(l, "", "")
 			} else {
-				errch <- h.ListenAndServe()
+				errch <- h.Serve(l)
 			}
 		}()
 	}
@@ -620,15 +857,19 @@ func (s *Server) HandleSIGHUP() {
 func (s *Server) serveRest(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Path == "/metrics" {
 		var internal bool
-		if s := s.MetricsSecret; s != "" {
-			if r.URL.Query().Get("secret") == s {
+		if secret := s.MetricsSecret; secret != "" {
+			if r.URL.Query().Get("secret") == secret {
 				internal = true
 			}
 		}
+		if !internal && s.metricsClientAllowed(r) {
+			internal = true
+		}
 
 		var ms []func(io.Writer)
 		if internal {
 			ms = append(ms, metrics.WriteProcessMetrics)
+			ms = append(ms, func(w io.Writer) { metrics.WritePrometheus(w, false) })
 			ms = append(ms, s.API0.WritePrometheus)
 		}
 		ms = append(ms, s.API0.ServerList.WritePrometheus)
@@ -669,6 +910,24 @@ func (s *Server) serveRest(w http.ResponseWriter, r *http.Request) {
 	http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
 }
 
+// proxyProtocolPolicy only honors a connection's PROXY protocol header if its
+// peer address is a trusted proxy; other connections are served as-is rather
+// than rejected, consistent with how untrusted peers are handled for
+// XFF/Forwarded/X-Real-IP.
+func (s *Server) proxyProtocolPolicy(upstream net.Addr) (proxyproto.Policy, error) {
+	tcp, ok := upstream.(*net.TCPAddr)
+	if !ok {
+		return proxyproto.SKIP, nil
+	}
+	a := tcp.AddrPort().Addr()
+	for _, p := range s.ProxyProtocolCIDRs {
+		if p.Contains(a) {
+			return proxyproto.USE, nil
+		}
+	}
+	return proxyproto.SKIP, nil
+}
+
 func (s *Server) sdnotify(state string) (bool, error) {
 	if s.NotifySocket == "" {
 		return false, nil
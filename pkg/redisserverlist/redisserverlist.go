@@ -0,0 +1,280 @@
+// Package redisserverlist implements api0.ServerListBackend on Redis,
+// allowing multiple Atlas front-ends behind a load balancer to share one
+// server list.
+//
+// Each server is stored as a JSON-encoded string value (not a Redis hash)
+// at key "atlas:serverlist:<id>" with a TTL
+// equal to the configured dead time; a heartbeat is simply a TTL refresh
+// (EXPIRE), so a server that stops heartbeating disappears on its own
+// without any node having to run a sweep. Adds, updates, and removes are
+// published on the "atlas:serverlist:events" pub/sub channel; New subscribes
+// to it immediately and maintains an in-process cache that List reads from,
+// so /client/servers is answered from memory on every node instead of doing
+// a SCAN plus one GET per server on every request. MaxServersPerIP is
+// enforced with a per-source-IP SET ("atlas:serverlist:ip:<ip>") so the
+// limit holds across the whole cluster, not just the node a server happened
+// to register with.
+package redisserverlist
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/r2northstar/atlas/pkg/api/api0"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	keyPrefix  = "atlas:serverlist:"
+	ipPrefix   = "atlas:serverlist:ip:"
+	eventsChan = "atlas:serverlist:events"
+)
+
+// EventKind identifies the kind of change a Backend published.
+type EventKind string
+
+const (
+	EventAdd    EventKind = "add"
+	EventUpdate EventKind = "update"
+	EventRemove EventKind = "remove"
+)
+
+// Event is published on eventsChan whenever the server list changes.
+type Event struct {
+	Kind EventKind       `json:"kind"`
+	ID   string          `json:"id"`
+	Srv  *api0.GameServer `json:"srv,omitempty"`
+}
+
+// Backend is a Redis-backed api0.ServerListBackend.
+type Backend struct {
+	rdb      *redis.Client
+	deadTime time.Duration
+
+	cacheMu sync.RWMutex
+	cache   map[string]*api0.GameServer
+}
+
+var _ api0.ServerListBackend = (*Backend)(nil)
+
+// New returns a Backend using rdb for storage and pub/sub, and starts the
+// background goroutine that keeps its local cache (see List) warm. deadTime
+// is the TTL given to a server's key when it is added, so a server that
+// registers and never heartbeats still expires on its own.
+func New(rdb *redis.Client, deadTime time.Duration) *Backend {
+	b := &Backend{rdb: rdb, deadTime: deadTime, cache: make(map[string]*api0.GameServer)}
+	b.startCache()
+	return b
+}
+
+// startCache seeds the cache with a one-time scan of Redis, then applies
+// every subsequent event from Subscribe to it for the lifetime of the
+// process. Heartbeat only refreshes a key's TTL without publishing an event,
+// so a server that stops heartbeating and expires out of Redis would
+// otherwise never be evicted from the cache; a periodic full rescan (rather
+// than relying on Redis keyspace-notification config) heals that.
+func (b *Backend) startCache() {
+	ctx := context.Background()
+	b.rescan(ctx)
+
+	ch, _ := b.Subscribe(ctx)
+	go func() {
+		for ev := range ch {
+			b.cacheMu.Lock()
+			switch ev.Kind {
+			case EventAdd, EventUpdate:
+				if ev.Srv != nil {
+					b.cache[ev.ID] = ev.Srv
+				}
+			case EventRemove:
+				delete(b.cache, ev.ID)
+			}
+			b.cacheMu.Unlock()
+		}
+	}()
+
+	go func() {
+		interval := b.deadTime / 2
+		if interval <= 0 {
+			interval = time.Minute
+		}
+		for range time.Tick(interval) {
+			b.rescan(ctx)
+		}
+	}()
+}
+
+func (b *Backend) rescan(ctx context.Context) {
+	srvs, err := b.scan(ctx)
+	if err != nil {
+		return
+	}
+	cache := make(map[string]*api0.GameServer, len(srvs))
+	for _, srv := range srvs {
+		cache[srv.ID] = srv
+	}
+	b.cacheMu.Lock()
+	b.cache = cache
+	b.cacheMu.Unlock()
+}
+
+// Subscribe returns a channel of Events for every change made by any Atlas
+// node, for maintaining a warm local cache of the server list.
+func (b *Backend) Subscribe(ctx context.Context) (<-chan Event, func() error) {
+	sub := b.rdb.Subscribe(ctx, eventsChan)
+	ch := make(chan Event, 64)
+	go func() {
+		defer close(ch)
+		for msg := range sub.Channel() {
+			var ev Event
+			if err := json.Unmarshal([]byte(msg.Payload), &ev); err == nil {
+				ch <- ev
+			}
+		}
+	}()
+	return ch, sub.Close
+}
+
+func (b *Backend) publish(ctx context.Context, ev Event) {
+	if buf, err := json.Marshal(ev); err == nil {
+		b.rdb.Publish(ctx, eventsChan, buf)
+	}
+}
+
+func (b *Backend) Add(ctx context.Context, srv *api0.GameServer) error {
+	buf, err := json.Marshal(srv)
+	if err != nil {
+		return fmt.Errorf("marshal server: %w", err)
+	}
+	if err := b.rdb.Set(ctx, keyPrefix+srv.ID, buf, b.deadTime).Err(); err != nil {
+		return fmt.Errorf("redis: add server: %w", err)
+	}
+	if srv.IP != "" {
+		if err := b.rdb.SAdd(ctx, ipPrefix+srv.IP, srv.ID).Err(); err != nil {
+			return fmt.Errorf("redis: track server ip: %w", err)
+		}
+	}
+	b.publish(ctx, Event{Kind: EventAdd, ID: srv.ID, Srv: srv})
+	return nil
+}
+
+func (b *Backend) Update(ctx context.Context, id string, fn func(*api0.GameServer)) (bool, error) {
+	buf, err := b.rdb.Get(ctx, keyPrefix+id).Bytes()
+	if err == redis.Nil {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("redis: get server: %w", err)
+	}
+
+	var srv api0.GameServer
+	if err := json.Unmarshal(buf, &srv); err != nil {
+		return false, fmt.Errorf("unmarshal server: %w", err)
+	}
+	fn(&srv)
+
+	ttl, err := b.rdb.TTL(ctx, keyPrefix+id).Result()
+	if err != nil {
+		return false, fmt.Errorf("redis: get server ttl: %w", err)
+	}
+
+	nbuf, err := json.Marshal(&srv)
+	if err != nil {
+		return false, fmt.Errorf("marshal server: %w", err)
+	}
+	if err := b.rdb.Set(ctx, keyPrefix+id, nbuf, ttl).Err(); err != nil {
+		return false, fmt.Errorf("redis: update server: %w", err)
+	}
+	b.publish(ctx, Event{Kind: EventUpdate, ID: id, Srv: &srv})
+	return true, nil
+}
+
+func (b *Backend) Remove(ctx context.Context, id string) error {
+	buf, err := b.rdb.Get(ctx, keyPrefix+id).Bytes()
+	if err == redis.Nil {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("redis: get server: %w", err)
+	}
+	var srv api0.GameServer
+	if err := json.Unmarshal(buf, &srv); err == nil && srv.IP != "" {
+		b.rdb.SRem(ctx, ipPrefix+srv.IP, id)
+	}
+	if err := b.rdb.Del(ctx, keyPrefix+id).Err(); err != nil {
+		return fmt.Errorf("redis: remove server: %w", err)
+	}
+	b.publish(ctx, Event{Kind: EventRemove, ID: id})
+	return nil
+}
+
+// List returns the backend's local cache of the server list, kept warm by
+// startCache, instead of querying Redis on every call. A server whose key
+// expired without a Remove stays in the result until the next periodic
+// rescan.
+func (b *Backend) List(ctx context.Context) ([]*api0.GameServer, error) {
+	b.cacheMu.RLock()
+	defer b.cacheMu.RUnlock()
+	srvs := make([]*api0.GameServer, 0, len(b.cache))
+	for _, srv := range b.cache {
+		srvs = append(srvs, srv)
+	}
+	return srvs, nil
+}
+
+// scan does a full SCAN of Redis for the current server list, used to seed
+// the cache on startup.
+func (b *Backend) scan(ctx context.Context) ([]*api0.GameServer, error) {
+	var (
+		srvs   []*api0.GameServer
+		cursor uint64
+	)
+	for {
+		keys, next, err := b.rdb.Scan(ctx, cursor, keyPrefix+"*", 256).Result()
+		if err != nil {
+			return nil, fmt.Errorf("redis: scan servers: %w", err)
+		}
+		for _, k := range keys {
+			if buf, err := b.rdb.Get(ctx, k).Bytes(); err == nil {
+				var srv api0.GameServer
+				if json.Unmarshal(buf, &srv) == nil {
+					srvs = append(srvs, &srv)
+				}
+			}
+		}
+		if cursor = next; cursor == 0 {
+			break
+		}
+	}
+	return srvs, nil
+}
+
+func (b *Backend) Heartbeat(ctx context.Context, id string, deadTime time.Duration) (bool, error) {
+	n, err := b.rdb.Expire(ctx, keyPrefix+id, deadTime).Result()
+	if err != nil {
+		return false, fmt.Errorf("redis: heartbeat: %w", err)
+	}
+	return n, nil
+}
+
+func (b *Backend) CountByIP(ctx context.Context, ip string) (int, error) {
+	ids, err := b.rdb.SMembers(ctx, ipPrefix+ip).Result()
+	if err != nil {
+		return 0, fmt.Errorf("redis: count by ip: %w", err)
+	}
+	var n int
+	for _, id := range ids {
+		exists, err := b.rdb.Exists(ctx, keyPrefix+id).Result()
+		if err != nil {
+			return 0, fmt.Errorf("redis: count by ip: %w", err)
+		}
+		if exists == 0 {
+			// expired without a Remove; drop the stale set member
+			b.rdb.SRem(ctx, ipPrefix+ip, id)
+			continue
+		}
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,181 @@
+// Package trustedproxy recovers the real client IP from a request that may
+// have passed through one or more reverse proxies, without trusting headers
+// blindly: the immediate peer (r.RemoteAddr) must fall within a configured
+// set of trusted CIDRs before any header is consulted at all, and for
+// multi-hop headers (X-Forwarded-For, Forwarded) the hop list is walked from
+// the right (closest to Atlas) skipping only addresses that are themselves
+// trusted proxies, stopping at the first untrusted (i.e., real client) hop.
+//
+// This generalizes the previous Cloudflare-only integration to arbitrary,
+// operator-configured proxies. Cloudflare itself is not one of the Modes
+// here: cloudflare.RealIP keeps its own trusted CIDR list updated from
+// Cloudflare's published ranges, which this package's static Config.CIDRs
+// can't express, so TrustedProxies.Mode "cloudflare" still calls
+// cloudflare.RealIP directly instead of going through New.
+package trustedproxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Mode identifies how the real client IP is recovered from a trusted proxy's
+// request.
+type Mode string
+
+const (
+	// ModeXFF reads the right-most untrusted address in X-Forwarded-For.
+	ModeXFF Mode = "x-forwarded-for"
+	// ModeForwarded reads the right-most untrusted "for=" parameter from the
+	// Forwarded header (RFC 7239).
+	ModeForwarded Mode = "forwarded"
+	// ModeXRealIP trusts X-Real-Ip verbatim; it is only meaningful with a
+	// single well-known hop (e.g. a local nginx) since it cannot carry a chain.
+	ModeXRealIP Mode = "x-real-ip"
+)
+
+// Config configures the trusted-proxy middleware.
+type Config struct {
+	// CIDRs lists the proxies (or proxy subnets) that are allowed to set the
+	// real-IP header. A request whose immediate peer isn't in CIDRs is
+	// passed through unmodified.
+	CIDRs []netip.Prefix
+	// Mode selects which header (if any) is trusted for recovering the real
+	// client IP.
+	Mode Mode
+	// Header overrides the header name consulted in ModeXRealIP (default
+	// X-Real-Ip). This lets a proxy that sends the client IP in a different
+	// single-address header (e.g. Cf-Connecting-Ip) use ModeXRealIP.
+	Header string
+	// OnError, if set, is called whenever a trusted peer's header can't be
+	// parsed, e.g. because it was spoofed to omit any untrusted hop. The
+	// request is not rejected either way: it is passed on with its
+	// RemoteAddr unmodified.
+	OnError func(r *http.Request, err error)
+}
+
+// New returns middleware that rewrites r.RemoteAddr to the recovered client
+// IP, preserving the original port, whenever the request's immediate peer is
+// a trusted proxy.
+func New(c Config) (func(http.Handler) http.Handler, error) {
+	switch c.Mode {
+	case ModeXFF, ModeForwarded, ModeXRealIP:
+	default:
+		return nil, fmt.Errorf("unknown trusted proxy header mode %q", c.Mode)
+	}
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if addr, ok := recover_(c, r); ok {
+				r2 := *r
+				r2.RemoteAddr = addr
+				r = &r2
+			}
+			h.ServeHTTP(w, r)
+		})
+	}, nil
+}
+
+func recover_(c Config, r *http.Request) (string, bool) {
+	peer, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return "", false
+	}
+	if !trusted(c.CIDRs, peer.Addr()) {
+		return "", false
+	}
+
+	var ip netip.Addr
+	switch c.Mode {
+	case ModeXFF:
+		ip, err = rightmostUntrusted(c.CIDRs, r.Header.Values("X-Forwarded-For"), ',')
+	case ModeForwarded:
+		ip, err = forwardedFor(c.CIDRs, r.Header.Values("Forwarded"))
+	case ModeXRealIP:
+		header := c.Header
+		if header == "" {
+			header = "X-Real-Ip"
+		}
+		if v := r.Header.Get(header); v != "" {
+			ip, err = netip.ParseAddr(v)
+		} else {
+			err = fmt.Errorf("missing %s header", header)
+		}
+	}
+	if err != nil {
+		if c.OnError != nil {
+			c.OnError(r, err)
+		}
+		return "", false
+	}
+	return netip.AddrPortFrom(ip, peer.Port()).String(), true
+}
+
+func trusted(cidrs []netip.Prefix, a netip.Addr) bool {
+	for _, p := range cidrs {
+		if p.Contains(a) {
+			return true
+		}
+	}
+	return false
+}
+
+// rightmostUntrusted walks a comma-separated multi-value header (as found in
+// possibly-repeated X-Forwarded-For instances) from right to left, skipping
+// addresses that are themselves trusted proxies, and returns the first
+// (i.e., rightmost) address that isn't.
+func rightmostUntrusted(cidrs []netip.Prefix, values []string, sep byte) (netip.Addr, error) {
+	var hops []string
+	for _, v := range values {
+		for _, h := range strings.Split(v, string(sep)) {
+			if h = strings.TrimSpace(h); h != "" {
+				hops = append(hops, h)
+			}
+		}
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		a, err := netip.ParseAddr(hops[i])
+		if err != nil {
+			return netip.Addr{}, fmt.Errorf("parse hop %q: %w", hops[i], err)
+		}
+		if !trusted(cidrs, a) {
+			return a, nil
+		}
+	}
+	return netip.Addr{}, fmt.Errorf("no untrusted hop found")
+}
+
+// forwardedFor extracts the "for=" tokens from RFC 7239 Forwarded headers
+// and applies the same right-to-left trust walk as X-Forwarded-For.
+func forwardedFor(cidrs []netip.Prefix, values []string) (netip.Addr, error) {
+	var hops []string
+	for _, v := range values {
+		for _, elem := range strings.Split(v, ",") {
+			for _, pair := range strings.Split(elem, ";") {
+				k, v, ok := strings.Cut(pair, "=")
+				if !ok || !strings.EqualFold(strings.TrimSpace(k), "for") {
+					continue
+				}
+				v = strings.Trim(strings.TrimSpace(v), `"`)
+				v = strings.TrimPrefix(v, "[")
+				if h, _, ok := strings.Cut(v, "]"); ok {
+					v = h
+				} else if h, _, ok := strings.Cut(v, ":"); ok {
+					v = h
+				}
+				hops = append(hops, v)
+			}
+		}
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		a, err := netip.ParseAddr(hops[i])
+		if err != nil {
+			return netip.Addr{}, fmt.Errorf("parse hop %q: %w", hops[i], err)
+		}
+		if !trusted(cidrs, a) {
+			return a, nil
+		}
+	}
+	return netip.Addr{}, fmt.Errorf("no untrusted hop found")
+}
@@ -0,0 +1,147 @@
+package trustedproxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func prefixes(t *testing.T, ss ...string) []netip.Prefix {
+	t.Helper()
+	var ps []netip.Prefix
+	for _, s := range ss {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			t.Fatalf("parse prefix %q: %v", s, err)
+		}
+		ps = append(ps, p)
+	}
+	return ps
+}
+
+func TestRecoverXFF(t *testing.T) {
+	cidrs := prefixes(t, "10.0.0.0/8")
+
+	cases := []struct {
+		name       string
+		remoteAddr string
+		xff        []string
+		want       string
+		wantOK     bool
+	}{
+		{
+			name:       "untrusted peer passes through unmodified",
+			remoteAddr: "1.2.3.4:1234",
+			xff:        []string{"5.6.7.8"},
+			wantOK:     false,
+		},
+		{
+			name:       "single untrusted hop",
+			remoteAddr: "10.0.0.1:1234",
+			xff:        []string{"203.0.113.9"},
+			want:       "203.0.113.9:1234",
+			wantOK:     true,
+		},
+		{
+			name:       "walks right to left past trusted proxies",
+			remoteAddr: "10.0.0.1:1234",
+			xff:        []string{"203.0.113.9, 10.0.0.2, 10.0.0.3"},
+			want:       "203.0.113.9:1234",
+			wantOK:     true,
+		},
+		{
+			name:       "multiple header instances are concatenated",
+			remoteAddr: "10.0.0.1:1234",
+			xff:        []string{"203.0.113.9", "10.0.0.2"},
+			want:       "203.0.113.9:1234",
+			wantOK:     true,
+		},
+		{
+			name:       "all hops trusted fails closed",
+			remoteAddr: "10.0.0.1:1234",
+			xff:        []string{"10.0.0.2, 10.0.0.3"},
+			wantOK:     false,
+		},
+		{
+			name:       "unparseable hop fails closed",
+			remoteAddr: "10.0.0.1:1234",
+			xff:        []string{"not-an-ip"},
+			wantOK:     false,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mw, err := New(Config{CIDRs: cidrs, Mode: ModeXFF})
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			var got string
+			h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.RemoteAddr
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = c.remoteAddr
+			for _, v := range c.xff {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), r)
+			if c.wantOK {
+				if got != c.want {
+					t.Errorf("RemoteAddr = %q, want %q", got, c.want)
+				}
+			} else if got != c.remoteAddr {
+				t.Errorf("RemoteAddr = %q, want unmodified %q", got, c.remoteAddr)
+			}
+		})
+	}
+}
+
+func TestRecoverForwarded(t *testing.T) {
+	cidrs := prefixes(t, "10.0.0.0/8")
+	mw, err := New(Config{CIDRs: cidrs, Mode: ModeForwarded})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	var got string
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.RemoteAddr
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Add("Forwarded", `for=203.0.113.9;proto=https, for=10.0.0.2`)
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	if want := "203.0.113.9:1234"; got != want {
+		t.Errorf("RemoteAddr = %q, want %q", got, want)
+	}
+}
+
+func TestRecoverXRealIP(t *testing.T) {
+	cidrs := prefixes(t, "10.0.0.0/8")
+	mw, err := New(Config{CIDRs: cidrs, Mode: ModeXRealIP, Header: "Cf-Connecting-Ip"})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	var got string
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.RemoteAddr
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("Cf-Connecting-Ip", "203.0.113.9")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	if want := "203.0.113.9:1234"; got != want {
+		t.Errorf("RemoteAddr = %q, want %q", got, want)
+	}
+}
+
+func TestNewRejectsUnknownMode(t *testing.T) {
+	if _, err := New(Config{Mode: "bogus"}); err == nil {
+		t.Fatal("expected an error for an unknown mode")
+	}
+}